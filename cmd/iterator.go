@@ -0,0 +1,18 @@
+package main
+
+import "kvs/internal/btree"
+
+// dbIterator adapts a btree.Cursor to the Iterator interface.
+type dbIterator struct {
+	cur *btree.Cursor
+}
+
+func (it *dbIterator) HasNext() bool {
+	return it.cur.Valid()
+}
+
+func (it *dbIterator) Next() (key []byte, val []byte) {
+	key, val = it.cur.Key(), it.cur.Val()
+	it.cur.Next()
+	return key, val
+}
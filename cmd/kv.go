@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+
+	"kvs/internal/btree"
+	"kvs/internal/pager"
+)
+
+// DB is the on-disk implementation of KV: an mmap-backed pager hands pages
+// to a btree.BTree, and the tree's root is persisted in the pager's meta
+// page, so a restart picks up exactly where the last Commit left off.
+type DB struct {
+	tree *btree.BTree
+	pgr  *pager.Pager
+}
+
+var _ KV = (*DB)(nil)
+
+// Open opens (creating if necessary) the database file at path.
+func Open(path string) (*DB, error) {
+	pgr, err := pager.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	tree := btree.New(pgr.Get, pgr.New, pgr.Del)
+	tree.SetRoot(pgr.Root())
+	return &DB{tree: tree, pgr: pgr}, nil
+}
+
+// Close unmaps and closes the underlying file.
+func (db *DB) Close() error {
+	return db.pgr.Close()
+}
+
+func (db *DB) Get(key []byte) (val []byte, ok bool) {
+	return db.tree.Get(key)
+}
+
+func (db *DB) Set(key []byte, val []byte) {
+	db.tree.Insert(key, val)
+	db.commit()
+}
+
+func (db *DB) Del(key []byte) {
+	db.tree.Delete(key)
+	db.commit()
+}
+
+// FindGreaterThan returns an Iterator over every key strictly greater than
+// key, in ascending order.
+func (db *DB) FindGreaterThan(key []byte) Iterator {
+	cur := db.tree.SeekGE(key)
+	if cur.Valid() && bytes.Equal(cur.Key(), key) {
+		cur.Next()
+	}
+	return &dbIterator{cur: cur}
+}
+
+// commit persists the tree's current root, flushes every page written
+// since the last commit, and hands any now-unreachable pages back to the
+// pager's freelist. DB never exposes a Snapshot, so the tree's own current
+// txid is always a safe horizon - no reader could be pinning anything
+// older.
+func (db *DB) commit() {
+	db.pgr.SetRoot(db.tree.Root())
+	if err := db.pgr.Commit(); err != nil {
+		panic(err)
+	}
+	db.tree.ReleaseSnapshotsOlderThan(db.tree.Txid())
+}
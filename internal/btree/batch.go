@@ -0,0 +1,231 @@
+package btree
+
+import (
+	"bytes"
+	"sort"
+
+	"kvs/internal/utils"
+)
+
+// OpKind tags what an Op does to its Key.
+type OpKind int
+
+const (
+	OpSet OpKind = iota
+	OpDel
+)
+
+// Op is one mutation in a Tree.ApplyBatch call: OpSet stores Val under Key,
+// OpDel removes Key (Val is ignored for OpDel).
+type Op struct {
+	Kind OpKind
+	Key  []byte
+	Val  []byte
+}
+
+// ApplyBatch applies every op with a single recursive descent per touched
+// subtree, instead of treeInsert/treeDelete's one root-to-leaf walk and
+// node allocation per key. ops needn't be sorted and may repeat a key; for
+// duplicates, the op closest to the end of ops wins, mirroring what
+// replaying ops one at a time in order would do.
+func (tree *BTree) ApplyBatch(ops []Op) {
+	if len(ops) == 0 {
+		return
+	}
+	for _, op := range ops {
+		utils.Assert(len(op.Key) > 0 && len(op.Key) <= BTREE_MAX_KEY_SIZE)
+	}
+	sorted := append([]Op(nil), ops...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].Key, sorted[j].Key) < 0
+	})
+	sorted = lastWriteWins(sorted)
+
+	tree.txid++
+	if tree.root == 0 {
+		// mirrors Insert's first-insert case: a single leaf with one dummy
+		// empty key, which always sorts before every real key.
+		root := BNode(make([]byte, BTREE_PAGE_SIZE))
+		root.setHeader(BNODE_LEAF, 1)
+		nodeAppendKV(root, 0, 0, nil, nil)
+		tree.root = tree.new(root)
+	}
+
+	new := applyBatchNode(tree, tree.get(tree.root), sorted)
+	tree.freePage(tree.root)
+	if new.btype() == BNODE_NODE && new.nkeys() == 0 {
+		// the batch drained every child mergeNode kept (see its own
+		// nkeys()==0 drop): the tree is now empty.
+		tree.root = 0
+		return
+	}
+	if new.btype() == BNODE_NODE && new.nkeys() == 1 {
+		// the root shrank to a single child: collapse it, same as Delete.
+		tree.root = new.getPtr(0)
+		return
+	}
+	nsplit, split := nodeSplit3(new)
+	if nsplit > 1 {
+		root := BNode(make([]byte, BTREE_PAGE_SIZE))
+		root.setHeader(BNODE_NODE, nsplit)
+		for i, knode := range split[:nsplit] {
+			nodeAppendKV(root, uint16(i), tree.new(knode), knode.getKey(0), nil)
+		}
+		tree.root = tree.new(root)
+	} else {
+		tree.root = tree.new(split[0])
+	}
+}
+
+// lastWriteWins collapses key-sorted ops down to one entry per key, keeping
+// whichever occurrence is later in ops - a stable sort preserves each key's
+// original relative order, so that's the one closest to the end of ops.
+func lastWriteWins(sorted []Op) []Op {
+	out := sorted[:0]
+	for i, op := range sorted {
+		if i+1 < len(sorted) && bytes.Equal(sorted[i+1].Key, op.Key) {
+			continue
+		}
+		out = append(out, op)
+	}
+	return out
+}
+
+// makeNodeBuf allocates a buffer sized to fit size bytes, but never smaller
+// than one page: nodeSplit3 reslices an already-small-enough node back up
+// to BTREE_PAGE_SIZE (every node occupies a full page on disk), so its
+// input needs at least that much backing capacity even when its real
+// content is smaller.
+func makeNodeBuf(size int) BNode {
+	if size < BTREE_PAGE_SIZE {
+		size = BTREE_PAGE_SIZE
+	}
+	return BNode(make([]byte, size))
+}
+
+// applyBatchNode applies ops (sorted by Key, one entry per key) to the
+// subtree rooted at node, returning the rebuilt node. Like treeInsert's
+// result, it may be temporarily oversized; the caller runs nodeSplit3 on it.
+func applyBatchNode(tree *BTree, node BNode, ops []Op) BNode {
+	switch node.btype() {
+	case BNODE_LEAF:
+		return mergeLeaf(tree, node, ops)
+	case BNODE_NODE:
+		return mergeNode(tree, node, ops)
+	default:
+		panic("bad node type")
+	}
+}
+
+// kidInfo is a child link bound for the rebuilt parent node: either an
+// untouched child (ptr reused as-is) or one piece of a touched child that
+// applyBatchNode plus nodeSplit3 just produced (ptr freshly allocated).
+type kidInfo struct {
+	ptr uint64
+	key []byte
+}
+
+// mergeNode groups ops by which child's key range they fall into - a
+// single linear pass since both node's children and ops are sorted by key
+// - recurses once per touched child, and rebuilds the node from the
+// untouched children plus each touched child's (possibly split) result.
+func mergeNode(tree *BTree, node BNode, ops []Op) BNode {
+	nkeys := node.nkeys()
+	kids := make([]kidInfo, 0, nkeys)
+	j := 0
+	for idx := uint16(0); idx < nkeys; idx++ {
+		start := j
+		for j < len(ops) && (idx+1 == nkeys || bytes.Compare(ops[j].Key, node.getKey(idx+1)) < 0) {
+			j++
+		}
+		childOps := ops[start:j]
+		kptr := node.getPtr(idx)
+		if len(childOps) == 0 {
+			kids = append(kids, kidInfo{ptr: kptr, key: node.getKey(idx)})
+			continue
+		}
+		childNode := applyBatchNode(tree, tree.get(kptr), childOps)
+		tree.freePage(kptr)
+		nsplit, split := nodeSplit3(childNode)
+		for i := uint16(0); i < nsplit; i++ {
+			piece := split[i]
+			if piece.nkeys() == 0 {
+				// a batch deleted every key that fell in this child: drop it
+				// rather than merging with a sibling like treeDelete does -
+				// ApplyBatch trades that merge for a single descent, so a
+				// batch that empties a child just shrinks the tree instead.
+				continue
+			}
+			kids = append(kids, kidInfo{ptr: tree.new(piece), key: piece.getKey(0)})
+		}
+	}
+
+	size := headerSize
+	for _, k := range kids {
+		size += 8 + 2 + 4 + len(k.key)
+	}
+	new := makeNodeBuf(size)
+	new.setHeader(BNODE_NODE, uint16(len(kids)))
+	for i, k := range kids {
+		nodeAppendKV(new, uint16(i), k.ptr, k.key, nil)
+	}
+	return new
+}
+
+// leafEntry is one key/value pair bound for a rebuilt leaf, already
+// resolved to whatever storeLeafVal decided (inline bytes or an overflow
+// reference).
+type leafEntry struct {
+	key   []byte
+	val   []byte
+	isRef bool
+}
+
+// mergeLeaf merges old's entries with ops in one sorted-merge pass,
+// applying every Set/Del in place of the leafInsert/leafUpdate/leafDelete
+// calls a one-op-at-a-time apply would need.
+func mergeLeaf(tree *BTree, old BNode, ops []Op) BNode {
+	entries := make([]leafEntry, 0, int(old.nkeys())+len(ops))
+	i, j := uint16(0), 0
+	for i < old.nkeys() || j < len(ops) {
+		switch {
+		case j >= len(ops) || (i < old.nkeys() && bytes.Compare(old.getKey(i), ops[j].Key) < 0):
+			// old entry has no matching op: carry it over unchanged.
+			entries = append(entries, leafEntry{key: old.getKey(i), val: old.getVal(i), isRef: old.valIsOverflow(i)})
+			i++
+		case i >= old.nkeys() || bytes.Compare(ops[j].Key, old.getKey(i)) < 0:
+			// a new key with no old entry: OpSet inserts, OpDel is a no-op.
+			if ops[j].Kind == OpSet {
+				stored, isRef := storeLeafVal(tree, ops[j].Val)
+				entries = append(entries, leafEntry{key: ops[j].Key, val: stored, isRef: isRef})
+			}
+			j++
+		default: // same key: the op replaces or removes the old entry.
+			if old.valIsOverflow(i) {
+				_, firstPgno := decodeOverflowRef(old.getVal(i))
+				freeOverflowChain(tree, firstPgno)
+			}
+			if ops[j].Kind == OpSet {
+				stored, isRef := storeLeafVal(tree, ops[j].Val)
+				entries = append(entries, leafEntry{key: ops[j].Key, val: stored, isRef: isRef})
+			}
+			i++
+			j++
+		}
+	}
+
+	size := headerSize
+	for _, e := range entries {
+		size += 8 + 2 + 4 + len(e.key) + len(e.val)
+	}
+	new := makeNodeBuf(size)
+	new.setHeader(BNODE_LEAF, uint16(len(entries)))
+	for idx, e := range entries {
+		if e.isRef {
+			nodeAppendKVRef(new, uint16(idx), 0, e.key, e.val)
+		} else {
+			nodeAppendKV(new, uint16(idx), 0, e.key, e.val)
+		}
+	}
+	return new
+}
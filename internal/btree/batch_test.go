@@ -0,0 +1,223 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyBatchSetAndGet(t *testing.T) {
+	tree := newMemTree(t)
+
+	ops := make([]Op, 0, 100)
+	for i := 0; i < 100; i++ {
+		ops = append(ops, Op{
+			Kind: OpSet,
+			Key:  []byte(fmt.Sprintf("key-%04d", i)),
+			Val:  []byte(fmt.Sprintf("val-%04d", i)),
+		})
+	}
+	tree.ApplyBatch(ops)
+
+	for i := 0; i < 100; i++ {
+		val, ok := tree.Get([]byte(fmt.Sprintf("key-%04d", i)))
+		assert.True(t, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("val-%04d", i)), val)
+	}
+}
+
+// TestApplyBatchLastWriteWins checks that when a batch sets and deletes the
+// same key, whichever op comes later in the slice decides the outcome,
+// regardless of key order.
+func TestApplyBatchLastWriteWins(t *testing.T) {
+	tree := newMemTree(t)
+
+	tree.ApplyBatch([]Op{
+		{Kind: OpSet, Key: []byte("k1"), Val: []byte("first")},
+		{Kind: OpSet, Key: []byte("k1"), Val: []byte("second")},
+	})
+	val, ok := tree.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("second"), val)
+
+	tree.ApplyBatch([]Op{
+		{Kind: OpDel, Key: []byte("k1")},
+		{Kind: OpSet, Key: []byte("k1"), Val: []byte("resurrected")},
+	})
+	val, ok = tree.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("resurrected"), val)
+
+	tree.ApplyBatch([]Op{
+		{Kind: OpSet, Key: []byte("k1"), Val: []byte("ignored")},
+		{Kind: OpDel, Key: []byte("k1")},
+	})
+	_, ok = tree.Get([]byte("k1"))
+	assert.False(t, ok)
+}
+
+// TestApplyBatchMixedOnExistingTree applies a mixed batch of sets, updates,
+// and deletes against a tree tall enough to need more than one level,
+// checking the result matches what applying the ops one at a time would
+// produce.
+func TestApplyBatchMixedOnExistingTree(t *testing.T) {
+	tree := newMemTree(t)
+	const n = 200 // enough for the root to split into 2 leaf children
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		val := []byte(fmt.Sprintf("val-%04d", i))
+		tree.Insert(key, val)
+	}
+
+	var ops []Op
+	for i := 0; i < n; i += 2 {
+		ops = append(ops, Op{Kind: OpDel, Key: []byte(fmt.Sprintf("key-%04d", i))})
+	}
+	for i := n; i < n+50; i++ {
+		ops = append(ops, Op{
+			Kind: OpSet,
+			Key:  []byte(fmt.Sprintf("key-%04d", i)),
+			Val:  []byte(fmt.Sprintf("val-%04d", i)),
+		})
+	}
+	for i := 1; i < n; i += 4 {
+		ops = append(ops, Op{
+			Kind: OpSet,
+			Key:  []byte(fmt.Sprintf("key-%04d", i)),
+			Val:  []byte(fmt.Sprintf("updated-%04d", i)),
+		})
+	}
+	tree.ApplyBatch(ops)
+
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		val, ok := tree.Get(key)
+		switch {
+		case i%2 == 0:
+			assert.False(t, ok, "key %s should have been deleted", key)
+		case i%4 == 1:
+			assert.True(t, ok)
+			assert.Equal(t, []byte(fmt.Sprintf("updated-%04d", i)), val)
+		default:
+			assert.True(t, ok)
+			assert.Equal(t, []byte(fmt.Sprintf("val-%04d", i)), val)
+		}
+	}
+	for i := n; i < n+50; i++ {
+		val, ok := tree.Get([]byte(fmt.Sprintf("key-%04d", i)))
+		assert.True(t, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("val-%04d", i)), val)
+	}
+}
+
+// TestApplyBatchOverflowValue checks that ApplyBatch both writes and frees
+// an overflow chain: one batch stores a big value, then a later batch
+// deletes the same key.
+func TestApplyBatchOverflowValue(t *testing.T) {
+	tree := newMemTree(t)
+
+	big := make([]byte, BTREE_MAX_VAL_SIZE*3+11)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	tree.ApplyBatch([]Op{
+		{Kind: OpSet, Key: []byte("blob"), Val: big},
+		{Kind: OpSet, Key: []byte("k2"), Val: []byte("v2")},
+	})
+
+	got, ok := tree.Get([]byte("blob"))
+	assert.True(t, ok)
+	assert.Equal(t, big, got)
+
+	tree.ApplyBatch([]Op{{Kind: OpDel, Key: []byte("blob")}})
+	_, ok = tree.Get([]byte("blob"))
+	assert.False(t, ok)
+}
+
+// TestApplyBatchEmptiesAChild checks that a batch deleting every key under
+// the root's 2nd child (so none of them is the permanent empty-key
+// sentinel that always keeps the leftmost leaf non-empty) doesn't panic -
+// mergeNode used to call getKey(0) on the resulting zero-key leaf.
+func TestApplyBatchEmptiesAChild(t *testing.T) {
+	tree := newMemTree(t)
+	const n = 196 // enough for the root to split into exactly 2 leaf children
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		val := []byte(fmt.Sprintf("val-%04d", i))
+		tree.Insert(key, val)
+	}
+	root := BNode(tree.get(tree.root))
+	assert.Equal(t, uint16(BNODE_NODE), root.btype())
+	assert.Equal(t, uint16(2), root.nkeys())
+	secondChildKey := root.getKey(1)
+
+	var ops []Op
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		if bytes.Compare(key, secondChildKey) >= 0 {
+			ops = append(ops, Op{Kind: OpDel, Key: key})
+		}
+	}
+	tree.ApplyBatch(ops)
+
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		_, ok := tree.Get(key)
+		if bytes.Compare(key, secondChildKey) >= 0 {
+			assert.False(t, ok, "key %s should have been deleted", key)
+		} else {
+			assert.True(t, ok, "key %s should still be present", key)
+		}
+	}
+}
+
+// TestApplyBatchDrainsRootToEmpty checks that a batch draining every key
+// out of every one of the root's children collapses the tree to empty
+// (root 0) instead of leaving a 0-key BNODE_NODE behind for the next
+// Get/Insert/Delete to panic on. The public API rejects the empty-key
+// sentinel (see TestEmptyKeyRejected), which in practice always keeps the
+// leftmost leaf non-empty, so this builds a sentinel-free tree directly to
+// exercise mergeNode's/ApplyBatch's defensive nkeys()==0 handling.
+func TestApplyBatchDrainsRootToEmpty(t *testing.T) {
+	tree := newMemTree(t)
+
+	left := BNode(make([]byte, BTREE_PAGE_SIZE))
+	left.setHeader(BNODE_LEAF, 1)
+	nodeAppendKV(left, 0, 0, []byte("k1"), []byte("v1"))
+	right := BNode(make([]byte, BTREE_PAGE_SIZE))
+	right.setHeader(BNODE_LEAF, 1)
+	nodeAppendKV(right, 0, 0, []byte("k2"), []byte("v2"))
+
+	root := BNode(make([]byte, BTREE_PAGE_SIZE))
+	root.setHeader(BNODE_NODE, 2)
+	nodeAppendKV(root, 0, tree.new(left), []byte("k1"), nil)
+	nodeAppendKV(root, 1, tree.new(right), []byte("k2"), nil)
+	tree.SetRoot(tree.new(root))
+
+	tree.ApplyBatch([]Op{
+		{Kind: OpDel, Key: []byte("k1")},
+		{Kind: OpDel, Key: []byte("k2")},
+	})
+
+	assert.Equal(t, uint64(0), tree.Root())
+	_, ok := tree.Get([]byte("k1"))
+	assert.False(t, ok)
+
+	// the tree should be usable again afterwards, same as after deleting
+	// down to empty through Delete.
+	tree.Insert([]byte("k3"), []byte("v3"))
+	val, ok := tree.Get([]byte("k3"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v3"), val)
+}
+
+func TestApplyBatchEmpty(t *testing.T) {
+	tree := newMemTree(t)
+	tree.Insert([]byte("k1"), []byte("v1"))
+	tree.ApplyBatch(nil)
+	val, ok := tree.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v1"), val)
+}
@@ -10,11 +10,22 @@ import (
 const (
 	BNODE_NODE         = 1 // Internal nodes with pointers
 	BNODE_LEAF         = 2 // Leaf nodes with values
+	BNODE_OVERFLOW     = 3 // Overflow pages holding the tail of a big value
 	BTREE_PAGE_SIZE    = 4096
 	BTREE_MAX_KEY_SIZE = 1000
-	BTREE_MAX_VAL_SIZE = 3000
+	// BTREE_MAX_VAL_SIZE is the largest value a leaf stores inline. Bigger
+	// values spill into a chain of BNODE_OVERFLOW pages (see overflow.go)
+	// and the leaf stores only a small reference instead.
+	BTREE_MAX_VAL_SIZE = 512
 )
 
+// headerSize is the size in bytes of a node's fixed header (btype + nkeys).
+const headerSize = 4
+
+// overflowFlag is set in a leaf value's stored length to mark it as an
+// overflow reference (see overflow.go) rather than inline value bytes.
+const overflowFlag = uint16(0x8000)
+
 // BNode represents a B-tree node in memory.
 // Structure of a BNode:
 //
@@ -83,15 +94,25 @@ func (node BNode) getKey(idx uint16) []byte {
 	return node[pos+4:][:klen]
 }
 
-// Get the nth value data as a slice (for leaf nodes).
+// Get the nth value data as a slice (for leaf nodes). If the value is an
+// overflow reference this returns the reference bytes themselves (see
+// decodeOverflowRef), not the value they point to - resolving the chain
+// needs the tree's get() callback, which a bare BNode doesn't have.
 func (node BNode) getVal(idx uint16) []byte {
 	utils.Assert(idx < node.nkeys())
 	pos := node.kvPos(idx)
 	klen := binary.LittleEndian.Uint16(node[pos+0:])
-	vlen := binary.LittleEndian.Uint16(node[pos+2:])
+	vlen := binary.LittleEndian.Uint16(node[pos+2:]) &^ overflowFlag
 	return node[pos+4+klen:][:vlen]
 }
 
+// valIsOverflow reports whether the nth value is an overflow reference.
+func (node BNode) valIsOverflow(idx uint16) bool {
+	utils.Assert(idx < node.nkeys())
+	pos := node.kvPos(idx)
+	return binary.LittleEndian.Uint16(node[pos+2:])&overflowFlag != 0
+}
+
 // Node size in bytes using the last key's offset.
 func (node BNode) nbytes() uint16 {
 	return node.kvPos(node.nkeys())
@@ -110,37 +131,76 @@ func nodeAppendKV(new BNode, idx uint16, ptr uint64, key []byte, val []byte) {
 	new.setOffset(idx+1, new.getOffset(idx)+4+uint16((len(key)+len(val))))
 }
 
+// nodeAppendKVRef is nodeAppendKV's counterpart for a value stored as an
+// overflow reference rather than inline bytes.
+func nodeAppendKVRef(new BNode, idx uint16, ptr uint64, key []byte, ref []byte) {
+	new.setPtr(idx, ptr)
+	pos := new.kvPos(idx)
+	binary.LittleEndian.PutUint16(new[pos+0:], uint16(len(key)))
+	binary.LittleEndian.PutUint16(new[pos+2:], uint16(len(ref))|overflowFlag)
+	copy(new[pos+4:], key)
+	copy(new[pos+4+uint16(len(key)):], ref)
+	new.setOffset(idx+1, new.getOffset(idx)+4+uint16((len(key)+len(ref))))
+}
+
 // Append a range of keys from an old node to a new node.
 func nodeAppendRange(
 	new BNode, old BNode, dstNew uint16, srcOld uint16, n uint16,
 ) {
 	for i := uint16(0); i < n; i++ {
 		dst, src := dstNew+i, srcOld+i
-		nodeAppendKV(new, dst,
-			old.getPtr(src), old.getKey(src), old.getVal(src))
+		if old.valIsOverflow(src) {
+			nodeAppendKVRef(new, dst, old.getPtr(src), old.getKey(src), old.getVal(src))
+		} else {
+			nodeAppendKV(new, dst, old.getPtr(src), old.getKey(src), old.getVal(src))
+		}
 	}
 }
 
-// Insert a new key at position `idx` in a leaf node.
+// Insert a new key at position `idx` in a leaf node. isRef marks val as an
+// overflow reference rather than inline value bytes.
 func leafInsert(
-	new BNode, old BNode, idx uint16, key []byte, val []byte,
+	new BNode, old BNode, idx uint16, key []byte, val []byte, isRef bool,
 ) {
 	new.setHeader(BNODE_LEAF, old.nkeys()+1)
-	nodeAppendRange(new, old, 0, 0, idx)                   // copy the keys before `idx`
-	nodeAppendKV(new, idx, 0, key, val)                    // the new key
+	nodeAppendRange(new, old, 0, 0, idx) // copy the keys before `idx`
+	appendLeafVal(new, idx, key, val, isRef)
 	nodeAppendRange(new, old, idx+1, idx, old.nkeys()-idx) // keys from `idx`
 }
 
-// Update an existing key at position `idx` in a leaf node.
+// Update an existing key at position `idx` in a leaf node. isRef marks val
+// as an overflow reference rather than inline value bytes.
 func leafUpdate(
-	new BNode, old BNode, idx uint16, key []byte, val []byte,
+	new BNode, old BNode, idx uint16, key []byte, val []byte, isRef bool,
 ) {
 	new.setHeader(BNODE_LEAF, old.nkeys())
 	nodeAppendRange(new, old, 0, 0, idx)
-	nodeAppendKV(new, idx, 0, key, val)
+	appendLeafVal(new, idx, key, val, isRef)
 	nodeAppendRange(new, old, idx+1, idx+1, old.nkeys()-(idx+1))
 }
 
+func appendLeafVal(new BNode, idx uint16, key []byte, val []byte, isRef bool) {
+	if isRef {
+		nodeAppendKVRef(new, idx, 0, key, val)
+	} else {
+		nodeAppendKV(new, idx, 0, key, val)
+	}
+}
+
+// Delete the key at position `idx` from a leaf node.
+func leafDelete(new BNode, old BNode, idx uint16) {
+	new.setHeader(BNODE_LEAF, old.nkeys()-1)
+	nodeAppendRange(new, old, 0, 0, idx)
+	nodeAppendRange(new, old, idx, idx+1, old.nkeys()-(idx+1))
+}
+
+// Merge two adjacent nodes of the same type into one.
+func nodeMerge(new BNode, left BNode, right BNode) {
+	new.setHeader(left.btype(), left.nkeys()+right.nkeys())
+	nodeAppendRange(new, left, 0, 0, left.nkeys())
+	nodeAppendRange(new, right, left.nkeys(), 0, right.nkeys())
+}
+
 // Find the last postion that is less than or equal to the key
 func nodeLookupLE(node BNode, key []byte) uint16 {
 	nkeys := node.nkeys()
@@ -185,7 +245,7 @@ func nodeSplit2(left BNode, right BNode, old BNode) {
 	utils.Assert(nleft >= 1)
 	// try to fit the right half
 	right_bytes := func() uint16 {
-		return old.nkeys() - left_bytes() + 4
+		return old.nbytes() - left_bytes() + 4
 	}
 	for right_bytes() > BTREE_PAGE_SIZE {
 		nleft++
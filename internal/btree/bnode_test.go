@@ -66,7 +66,7 @@ func TestLeafInsert(t *testing.T) {
 	oldNode := setupBtreeNode()
 	newNode := BNode(make([]byte, BTREE_PAGE_SIZE))
 
-	leafInsert(newNode, oldNode, 3, []byte("k4"), []byte("v4"))
+	leafInsert(newNode, oldNode, 3, []byte("k4"), []byte("v4"), false)
 
 	assert.Equal(t, uint16(4), newNode.nkeys())
 	assert.Equal(t, BNODE_LEAF, int(newNode.btype()))
@@ -80,11 +80,51 @@ func TestLeafInsert(t *testing.T) {
 	assertNodeKVPairs(t, newNode, expectedPairs)
 }
 
+func TestLeafDelete(t *testing.T) {
+	oldNode := setupBtreeNode()
+	newNode := BNode(make([]byte, BTREE_PAGE_SIZE))
+
+	leafDelete(newNode, oldNode, 1)
+
+	assert.Equal(t, uint16(2), newNode.nkeys())
+	assert.Equal(t, BNODE_LEAF, int(newNode.btype()))
+
+	expectedPairs := []struct{ key, val string }{
+		{"k1", "v1"},
+		{"k3", "v3"},
+	}
+	assertNodeKVPairs(t, newNode, expectedPairs)
+}
+
+func TestNodeMerge(t *testing.T) {
+	left := BNode(make([]byte, BTREE_PAGE_SIZE))
+	left.setHeader(BNODE_LEAF, 2)
+	nodeAppendKV(left, 0, 0, []byte("k1"), []byte("v1"))
+	nodeAppendKV(left, 1, 0, []byte("k2"), []byte("v2"))
+
+	right := BNode(make([]byte, BTREE_PAGE_SIZE))
+	right.setHeader(BNODE_LEAF, 1)
+	nodeAppendKV(right, 0, 0, []byte("k3"), []byte("v3"))
+
+	merged := BNode(make([]byte, BTREE_PAGE_SIZE))
+	nodeMerge(merged, left, right)
+
+	assert.Equal(t, uint16(3), merged.nkeys())
+	assert.Equal(t, BNODE_LEAF, int(merged.btype()))
+
+	expectedPairs := []struct{ key, val string }{
+		{"k1", "v1"},
+		{"k2", "v2"},
+		{"k3", "v3"},
+	}
+	assertNodeKVPairs(t, merged, expectedPairs)
+}
+
 func TestLeafUpdate(t *testing.T) {
 	oldNode := setupBtreeNode()
 	newNode := BNode(make([]byte, BTREE_PAGE_SIZE))
 
-	leafUpdate(newNode, oldNode, 1, []byte("k2"), []byte("v2n"))
+	leafUpdate(newNode, oldNode, 1, []byte("k2"), []byte("v2n"), false)
 
 	assert.Equal(t, uint16(3), newNode.nkeys())
 	assert.Equal(t, BNODE_LEAF, int(newNode.btype()))
@@ -1,16 +1,253 @@
 package btree
 
-import "bytes"
+import (
+	"bytes"
+
+	"kvs/internal/utils"
+)
+
+// pendingFree is a page that a write has stopped referencing, tagged with
+// the txid that did so. It can't be handed back to the pager until no live
+// Snapshot predates that txid (see BTree.ReleaseSnapshotsOlderThan) -
+// otherwise a reader walking a frozen root could see the page reused for
+// something else mid-scan.
+type pendingFree struct {
+	pgno uint64
+	txid uint64
+}
 
 type BTree struct {
 	// root pointer (a nonzero page number)
 	root uint64
+	// txid counts write transactions (Insert/Delete/ApplyBatch calls); it's bumped
+	// before each one and stamped on every snapshot taken and page freed,
+	// so ReleaseSnapshotsOlderThan can tell which pending frees are safe.
+	txid uint64
+	// pending holds pages freed by a write but not yet handed back to the
+	// pager, because a live snapshot older than their txid might still
+	// need them.
+	pending []pendingFree
+	// liveTxids counts open snapshots per txid they were taken at.
+	liveTxids map[uint64]int
 	// callbacks for managing on-disk pages
 	get func(uint64) []byte // read data from a page number
 	new func([]byte) uint64 // allocate a new page number with data
 	del func(uint64)        // deallocate a page number
 }
 
+// New creates an empty BTree backed by the given page callbacks. The tree
+// has no root until the first Insert or ApplyBatch.
+func New(get func(uint64) []byte, new func([]byte) uint64, del func(uint64)) *BTree {
+	return &BTree{get: get, new: new, del: del, liveTxids: map[uint64]int{}}
+}
+
+// freePage retires pgno from the current txid rather than calling the del
+// callback directly, so a Snapshot taken before this write can keep reading
+// it until ReleaseSnapshotsOlderThan decides it's truly unreachable.
+func (tree *BTree) freePage(pgno uint64) {
+	tree.pending = append(tree.pending, pendingFree{pgno: pgno, txid: tree.txid})
+}
+
+// ReleaseSnapshotsOlderThan hands every pending-free page at or below txid
+// back to the pager, unless an open Snapshot is older than that page's
+// freeing txid and might still walk to it. Call this with the current
+// tree.txid after closing snapshots (or periodically); it never frees a
+// page a live Snapshot could still reach, since a Snapshot taken at or
+// after a page's freeing txid never referenced that page to begin with.
+func (tree *BTree) ReleaseSnapshotsOlderThan(txid uint64) {
+	horizon := txid
+	for t, n := range tree.liveTxids {
+		if n > 0 && t < horizon {
+			horizon = t
+		}
+	}
+	kept := tree.pending[:0]
+	for _, p := range tree.pending {
+		if p.txid <= horizon {
+			tree.del(p.pgno)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	tree.pending = kept
+}
+
+// Root returns the current root page number, or 0 for an empty tree.
+func (tree *BTree) Root() uint64 { return tree.root }
+
+// Txid returns the current write-transaction counter, e.g. for callers
+// that want to drain tree.pending via ReleaseSnapshotsOlderThan after every
+// write but never take a Snapshot themselves.
+func (tree *BTree) Txid() uint64 { return tree.txid }
+
+// SetRoot overrides the root page number, e.g. when recovering a tree
+// whose root was persisted elsewhere (see the pager package).
+func (tree *BTree) SetRoot(root uint64) { tree.root = root }
+
+// Get looks up a key, returning its value and whether it was found.
+func (tree *BTree) Get(key []byte) ([]byte, bool) {
+	if tree.root == 0 {
+		return nil, false
+	}
+	return treeGet(tree, tree.get(tree.root), key)
+}
+
+func treeGet(tree *BTree, node BNode, key []byte) ([]byte, bool) {
+	idx := nodeLookupLE(node, key)
+	switch node.btype() {
+	case BNODE_LEAF:
+		if idx < node.nkeys() && bytes.Equal(node.getKey(idx), key) {
+			if node.valIsOverflow(idx) {
+				totalLen, firstPgno := decodeOverflowRef(node.getVal(idx))
+				return readOverflowChain(tree, firstPgno, totalLen), true
+			}
+			return node.getVal(idx), true
+		}
+		return nil, false
+	case BNODE_NODE:
+		return treeGet(tree, tree.get(node.getPtr(idx)), key)
+	default:
+		panic("bad node type")
+	}
+}
+
+// Insert inserts a new key or updates an existing one, growing the root
+// from a single leaf into an internal node as needed.
+func (tree *BTree) Insert(key []byte, val []byte) {
+	utils.Assert(len(key) > 0 && len(key) <= BTREE_MAX_KEY_SIZE)
+	tree.txid++
+	if tree.root == 0 {
+		// the first insert: a single leaf with one dummy empty key.
+		// the empty key is never looked up for (no real key is empty),
+		// it only serves as a floor so nodeLookupLE always has a hit.
+		root := BNode(make([]byte, BTREE_PAGE_SIZE))
+		root.setHeader(BNODE_LEAF, 1)
+		nodeAppendKV(root, 0, 0, nil, nil)
+		tree.root = tree.new(root)
+	}
+	node := treeInsert(tree, tree.get(tree.root), key, val)
+	nsplit, split := nodeSplit3(node)
+	tree.freePage(tree.root)
+	if nsplit > 1 {
+		root := BNode(make([]byte, BTREE_PAGE_SIZE))
+		root.setHeader(BNODE_NODE, nsplit)
+		for i, knode := range split[:nsplit] {
+			nodeAppendKV(root, uint16(i), tree.new(knode), knode.getKey(0), nil)
+		}
+		tree.root = tree.new(root)
+	} else {
+		tree.root = tree.new(split[0])
+	}
+}
+
+// Delete removes a key, reporting whether it was present.
+func (tree *BTree) Delete(key []byte) bool {
+	utils.Assert(len(key) > 0 && len(key) <= BTREE_MAX_KEY_SIZE)
+	if tree.root == 0 {
+		return false
+	}
+	tree.txid++
+	updated := treeDelete(tree, tree.get(tree.root), key)
+	if len(updated) == 0 {
+		return false // not found
+	}
+	tree.freePage(tree.root)
+	if updated.btype() == BNODE_NODE && updated.nkeys() == 1 {
+		// the root shrank to a single child: collapse it away instead of
+		// persisting a useless level.
+		tree.root = updated.getPtr(0)
+	} else {
+		tree.root = tree.new(updated)
+	}
+	return true
+}
+
+// treeDelete deletes key from the tree rooted at node, returning the
+// replacement node, or an empty BNode if the key wasn't found.
+func treeDelete(tree *BTree, node BNode, key []byte) BNode {
+	idx := nodeLookupLE(node, key)
+	switch node.btype() {
+	case BNODE_LEAF:
+		if !bytes.Equal(key, node.getKey(idx)) {
+			return BNode{}
+		}
+		if node.valIsOverflow(idx) {
+			_, firstPgno := decodeOverflowRef(node.getVal(idx))
+			freeOverflowChain(tree, firstPgno)
+		}
+		new := BNode(make([]byte, BTREE_PAGE_SIZE))
+		leafDelete(new, node, idx)
+		return new
+	case BNODE_NODE:
+		return nodeDelete(tree, node, idx, key)
+	default:
+		panic("bad node type")
+	}
+}
+
+// nodeDelete deletes key from node's idx'th child, then merges the shrunk
+// child with a sibling (or just relinks it) depending on shouldMerge.
+func nodeDelete(tree *BTree, node BNode, idx uint16, key []byte) BNode {
+	kptr := node.getPtr(idx)
+	updated := treeDelete(tree, tree.get(kptr), key)
+	if len(updated) == 0 {
+		return BNode{} // not found
+	}
+	tree.freePage(kptr)
+
+	new := BNode(make([]byte, BTREE_PAGE_SIZE))
+	switch dir, sibling := shouldMerge(tree, node, idx, updated); {
+	case dir < 0: // merge with left sibling
+		merged := BNode(make([]byte, BTREE_PAGE_SIZE))
+		nodeMerge(merged, sibling, updated)
+		tree.freePage(node.getPtr(idx - 1))
+		nodeReplace2Kid(new, node, idx-1, tree.new(merged), merged.getKey(0))
+	case dir > 0: // merge with right sibling
+		merged := BNode(make([]byte, BTREE_PAGE_SIZE))
+		nodeMerge(merged, updated, sibling)
+		tree.freePage(node.getPtr(idx + 1))
+		nodeReplace2Kid(new, node, idx, tree.new(merged), merged.getKey(0))
+	default: // no sibling to merge with, just relink the shrunk child
+		nodeReplaceKidN(tree, new, node, idx, updated)
+	}
+	return new
+}
+
+// shouldMerge decides whether a child that just shrank to `updated` should
+// be merged with a sibling: it returns -1 for the left sibling, +1 for the
+// right, or 0 to leave it as is, together with the chosen sibling (if any).
+// A child above the BTREE_PAGE_SIZE/4 fill threshold is never merged, since
+// it isn't actually underflowing. Keys are never redistributed between
+// siblings: a child that would overflow a page when merged with either
+// sibling is relinked as is, still below the threshold.
+func shouldMerge(tree *BTree, node BNode, idx uint16, updated BNode) (int, BNode) {
+	if updated.nbytes() > BTREE_PAGE_SIZE/4 {
+		return 0, BNode{}
+	}
+	if idx > 0 {
+		sibling := BNode(tree.get(node.getPtr(idx - 1)))
+		if merged := sibling.nbytes() + updated.nbytes() - headerSize; merged <= BTREE_PAGE_SIZE {
+			return -1, sibling
+		}
+	}
+	if idx+1 < node.nkeys() {
+		sibling := BNode(tree.get(node.getPtr(idx + 1)))
+		if merged := updated.nbytes() + sibling.nbytes() - headerSize; merged <= BTREE_PAGE_SIZE {
+			return +1, sibling
+		}
+	}
+	return 0, BNode{}
+}
+
+// nodeReplace2Kid replaces 2 adjacent links (idx and idx+1) with a single
+// link, used when their kids have just been merged into one.
+func nodeReplace2Kid(new BNode, old BNode, idx uint16, mergedPtr uint64, mergedKey []byte) {
+	new.setHeader(BNODE_NODE, old.nkeys()-1)
+	nodeAppendRange(new, old, 0, 0, idx)
+	nodeAppendKV(new, idx, mergedPtr, mergedKey, nil)
+	nodeAppendRange(new, old, idx+1, idx+2, old.nkeys()-(idx+2))
+}
+
 // Replace a link with multiple links
 func nodeReplaceKidN(
 	tree *BTree, new BNode, old BNode, idx uint16,
@@ -32,10 +269,15 @@ func treeInsert(tree *BTree, node BNode, key []byte, val []byte) BNode {
 	idx := nodeLookupLE(node, key) // node.getKey(idx) <= key
 	switch node.btype() {
 	case BNODE_LEAF: // leaf node
+		stored, isRef := storeLeafVal(tree, val)
 		if bytes.Equal(key, node.getKey(idx)) {
-			leafUpdate(new, node, idx, key, val) // found, update it
+			if node.valIsOverflow(idx) {
+				_, firstPgno := decodeOverflowRef(node.getVal(idx))
+				freeOverflowChain(tree, firstPgno)
+			}
+			leafUpdate(new, node, idx, key, stored, isRef) // found, update it
 		} else {
-			leafInsert(new, node, idx+1, key, val) // not found, insert
+			leafInsert(new, node, idx+1, key, stored, isRef) // not found, insert
 		}
 	case BNODE_NODE: // internal node, walk into the child node
 		// recursive insertion to the kid node
@@ -44,7 +286,7 @@ func treeInsert(tree *BTree, node BNode, key []byte, val []byte) BNode {
 		// after insertion, split the result
 		nsplit, split := nodeSplit3(knode)
 		// deallocate the old kid node
-		tree.del(kptr)
+		tree.freePage(kptr)
 		// update the kid links
 		nodeReplaceKidN(tree, new, node, idx, split[:nsplit]...)
 	}
@@ -0,0 +1,172 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newMemTree returns an empty BTree backed by an in-memory map, used by
+// tree-level tests that don't care about persistence.
+func newMemTree(t *testing.T) *BTree {
+	pages := map[uint64][]byte{}
+	var next uint64 = 1
+	return New(
+		func(pgno uint64) []byte {
+			node, ok := pages[pgno]
+			if !ok {
+				t.Fatalf("get: no such page %d", pgno)
+			}
+			return node
+		},
+		func(data []byte) uint64 {
+			pgno := next
+			next++
+			pages[pgno] = append([]byte(nil), data...)
+			return pgno
+		},
+		func(pgno uint64) { delete(pages, pgno) },
+	)
+}
+
+func TestTreeInsertGetDelete(t *testing.T) {
+	tree := newMemTree(t)
+
+	tree.Insert([]byte("k1"), []byte("v1"))
+	tree.Insert([]byte("k2"), []byte("v2"))
+
+	val, ok := tree.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v1"), val)
+
+	assert.True(t, tree.Delete([]byte("k1")))
+	_, ok = tree.Get([]byte("k1"))
+	assert.False(t, ok)
+
+	val, ok = tree.Get([]byte("k2"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v2"), val)
+
+	assert.False(t, tree.Delete([]byte("missing")))
+}
+
+// TestTreeOverflowValue round-trips a value far bigger than
+// BTREE_MAX_VAL_SIZE, exercising the overflow chain end to end: write,
+// read back, overwrite with something smaller (freeing the chain), and
+// delete.
+func TestTreeOverflowValue(t *testing.T) {
+	tree := newMemTree(t)
+
+	big := make([]byte, BTREE_MAX_VAL_SIZE*5+37)
+	for i := range big {
+		big[i] = byte(i)
+	}
+	tree.Insert([]byte("blob"), big)
+
+	got, ok := tree.Get([]byte("blob"))
+	assert.True(t, ok)
+	assert.Equal(t, big, got)
+
+	tree.Insert([]byte("blob"), []byte("small now"))
+	got, ok = tree.Get([]byte("blob"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("small now"), got)
+
+	assert.True(t, tree.Delete([]byte("blob")))
+	_, ok = tree.Get([]byte("blob"))
+	assert.False(t, ok)
+}
+
+// TestTreeDeleteShrinksHeight inserts enough keys to force an internal root,
+// then deletes all but a handful and checks the root collapses back down
+// to a single leaf instead of leaving a half-empty internal level behind.
+func TestTreeDeleteShrinksHeight(t *testing.T) {
+	tree := newMemTree(t)
+
+	const n = 300
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		val := []byte(fmt.Sprintf("val-%04d", i))
+		tree.Insert(key, val)
+	}
+	root := BNode(tree.get(tree.root))
+	assert.Equal(t, BNODE_NODE, int(root.btype()), "expected multiple levels after %d inserts", n)
+
+	for i := 0; i < n-2; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		assert.True(t, tree.Delete(key), "delete %s", key)
+	}
+
+	root = BNode(tree.get(tree.root))
+	assert.Equal(t, BNODE_LEAF, int(root.btype()), "root should collapse back to a leaf")
+
+	for i := n - 2; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		val, ok := tree.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, []byte(fmt.Sprintf("val-%04d", i)), val)
+	}
+}
+
+// TestTreeDeleteRebalancesAcrossSiblings uses values just under
+// BTREE_MAX_VAL_SIZE, so they stay inline and keep fanout low, and a run of
+// deletions forces repeated merges cascading across several leaf siblings,
+// not just a single pair.
+func TestTreeDeleteRebalancesAcrossSiblings(t *testing.T) {
+	tree := newMemTree(t)
+
+	const n = 40
+	bigVal := make([]byte, 500)
+	for i := range bigVal {
+		bigVal[i] = byte('a' + i%26)
+	}
+	for i := 0; i < n; i++ {
+		key := []byte(fmt.Sprintf("key-%04d", i))
+		tree.Insert(key, bigVal)
+	}
+
+	// delete every other key, then the rest, checking invariants hold
+	// throughout the cascade of merges this triggers.
+	for _, pass := range [][]int{evens(n), odds(n)} {
+		for _, i := range pass {
+			key := []byte(fmt.Sprintf("key-%04d", i))
+			assert.True(t, tree.Delete(key), "delete %s", key)
+			_, ok := tree.Get(key)
+			assert.False(t, ok)
+		}
+	}
+
+	// the tree's permanent empty sentinel key is never deleted by real
+	// key deletions, so the root settles back to a single, nearly-empty
+	// leaf rather than page 0.
+	root := BNode(tree.get(tree.root))
+	assert.Equal(t, BNODE_LEAF, int(root.btype()))
+	assert.Equal(t, uint16(1), root.nkeys())
+}
+
+// TestEmptyKeyRejected checks that Insert, Delete, and ApplyBatch all
+// reject a real []byte{} key rather than silently colliding with the
+// tree's internal empty-key sentinel (see Cursor.isSentinel).
+func TestEmptyKeyRejected(t *testing.T) {
+	tree := newMemTree(t)
+	assert.Panics(t, func() { tree.Insert(nil, []byte("v")) })
+	assert.Panics(t, func() { tree.Delete(nil) })
+	assert.Panics(t, func() { tree.ApplyBatch([]Op{{Kind: OpSet, Key: nil, Val: []byte("v")}}) })
+}
+
+func evens(n int) []int {
+	var out []int
+	for i := 0; i < n; i += 2 {
+		out = append(out, i)
+	}
+	return out
+}
+
+func odds(n int) []int {
+	var out []int
+	for i := 1; i < n; i += 2 {
+		out = append(out, i)
+	}
+	return out
+}
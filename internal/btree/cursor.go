@@ -0,0 +1,229 @@
+package btree
+
+import "bytes"
+
+// frame records one step of a root-to-leaf descent: the node visited and
+// the index within it that the cursor is currently positioned at.
+type frame struct {
+	node BNode
+	idx  uint16
+}
+
+// Cursor is a position within a BTree, able to move forward or backward one
+// key at a time. It holds the full stack of frames from the root down to
+// the current leaf.
+//
+// Design trade-off: leaf nodes here carry no next-leaf pointer, so once a
+// leaf is exhausted the cursor resumes by popping frames back up to the
+// nearest ancestor with an unvisited child and descending again, rather
+// than following an O(1) sibling link. That makes crossing a leaf boundary
+// O(log N) instead of O(1). We picked this over adding a next_leaf field
+// because a sibling pointer has to be kept consistent across every split,
+// merge, and redistribution of a copy-on-write node (the sibling's pointer
+// to the page being replaced would need patching too), which undoes most of
+// the copy-on-write simplicity for a cost that only matters once scans
+// dominate over the per-key copying this tree already does on every write.
+type Cursor struct {
+	tree   *BTree
+	stack  []frame
+	endKey []byte // exclusive upper bound for Next(); nil means unbounded
+	valid  bool
+}
+
+// SeekGE positions a cursor at the first key >= key.
+func (tree *BTree) SeekGE(key []byte) *Cursor {
+	return seekGE(tree, tree.root, key)
+}
+
+// SeekLE positions a cursor at the last key <= key.
+func (tree *BTree) SeekLE(key []byte) *Cursor {
+	return seekLE(tree, tree.root, key)
+}
+
+// seekGE is SeekGE against an arbitrary root, so a Snapshot can seek its
+// own frozen root without going through the tree's live one.
+func seekGE(tree *BTree, root uint64, key []byte) *Cursor {
+	c := &Cursor{tree: tree}
+	if root == 0 {
+		return c
+	}
+	c.descend(tree.get(root), key)
+	node, idx := c.top()
+	if idx >= node.nkeys() {
+		return c
+	}
+	c.valid = true
+	if bytes.Compare(node.getKey(idx), key) < 0 {
+		c.Next()
+	}
+	if c.isSentinel() {
+		c.Next()
+	}
+	return c
+}
+
+// seekLE is SeekLE against an arbitrary root; see seekGE.
+func seekLE(tree *BTree, root uint64, key []byte) *Cursor {
+	c := &Cursor{tree: tree}
+	if root == 0 {
+		return c
+	}
+	c.descend(tree.get(root), key)
+	node, idx := c.top()
+	if idx >= node.nkeys() {
+		return c
+	}
+	c.valid = bytes.Compare(node.getKey(idx), key) <= 0
+	if c.isSentinel() {
+		// the only entry at or below key is the tree's internal
+		// empty-key placeholder (see Insert's first-leaf case), not a
+		// real one, so there's nothing real to report.
+		c.valid = false
+	}
+	return c
+}
+
+// isSentinel reports whether the cursor sits on the tree's internal
+// empty-key placeholder rather than a real entry. No real key is ever
+// empty (see Insert's first-leaf case), so that's a safe test.
+func (c *Cursor) isSentinel() bool {
+	return c.valid && len(c.Key()) == 0
+}
+
+// SetEnd bounds the cursor to keys strictly less than end; Valid() (and
+// thus the caller's scan loop) reports false once the cursor reaches it.
+// A nil end leaves the cursor unbounded.
+func (c *Cursor) SetEnd(end []byte) *Cursor {
+	c.endKey = end
+	if c.valid && c.endKey != nil && bytes.Compare(c.Key(), c.endKey) >= 0 {
+		c.valid = false
+	}
+	return c
+}
+
+// descend walks from node to the leaf that would contain key, pushing a
+// frame at every level via nodeLookupLE.
+func (c *Cursor) descend(node BNode, key []byte) {
+	idx := nodeLookupLE(node, key)
+	c.stack = append(c.stack, frame{node: node, idx: idx})
+	if node.btype() == BNODE_NODE {
+		c.descend(c.tree.get(node.getPtr(idx)), key)
+	}
+}
+
+// descendLeftmost pushes frames from node down to its leftmost leaf.
+func (c *Cursor) descendLeftmost(node BNode) {
+	for {
+		c.stack = append(c.stack, frame{node: node, idx: 0})
+		if node.btype() == BNODE_LEAF {
+			return
+		}
+		node = c.tree.get(node.getPtr(0))
+	}
+}
+
+// descendRightmost pushes frames from node down to its rightmost leaf.
+func (c *Cursor) descendRightmost(node BNode) {
+	for {
+		idx := node.nkeys() - 1
+		c.stack = append(c.stack, frame{node: node, idx: idx})
+		if node.btype() == BNODE_LEAF {
+			return
+		}
+		node = c.tree.get(node.getPtr(idx))
+	}
+}
+
+func (c *Cursor) top() (BNode, uint16) {
+	f := c.stack[len(c.stack)-1]
+	return f.node, f.idx
+}
+
+// Valid reports whether the cursor is positioned on a key within bounds.
+func (c *Cursor) Valid() bool {
+	if !c.valid {
+		return false
+	}
+	if c.endKey != nil && bytes.Compare(c.Key(), c.endKey) >= 0 {
+		return false
+	}
+	return true
+}
+
+// Key returns the key at the cursor's current position.
+func (c *Cursor) Key() []byte {
+	node, idx := c.top()
+	return node.getKey(idx)
+}
+
+// Val returns the value at the cursor's current position, resolving it
+// through the overflow chain if it was too big to store inline.
+func (c *Cursor) Val() []byte {
+	node, idx := c.top()
+	if node.valIsOverflow(idx) {
+		totalLen, firstPgno := decodeOverflowRef(node.getVal(idx))
+		return readOverflowChain(c.tree, firstPgno, totalLen)
+	}
+	return node.getVal(idx)
+}
+
+// Next advances the cursor to the next key in ascending order, reporting
+// whether a key remains.
+func (c *Cursor) Next() bool {
+	if !c.valid {
+		return false
+	}
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		top.idx++
+		if top.idx < top.node.nkeys() {
+			if top.node.btype() == BNODE_LEAF {
+				c.valid = true
+				return true
+			}
+			c.descendLeftmost(c.tree.get(top.node.getPtr(top.idx)))
+			c.valid = true
+			return true
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	c.valid = false
+	return false
+}
+
+// Prev moves the cursor to the previous key in ascending order (i.e. the
+// next key in descending/reverse order), reporting whether a key remains.
+func (c *Cursor) Prev() bool {
+	if !c.valid {
+		return false
+	}
+	for len(c.stack) > 0 {
+		top := &c.stack[len(c.stack)-1]
+		if top.idx > 0 {
+			top.idx--
+			if top.node.btype() != BNODE_LEAF {
+				c.descendRightmost(c.tree.get(top.node.getPtr(top.idx)))
+			}
+			c.valid = true
+			if c.isSentinel() {
+				// reverse traversal is the only direction that can land on
+				// the tree's empty-key placeholder, since it's the minimum
+				// possible key.
+				c.valid = false
+			}
+			return c.valid
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+	c.valid = false
+	return false
+}
+
+// Close releases the cursor's pinned pages back to the pager. The
+// in-memory get() used today doesn't pin anything, so this only drops the
+// cursor's own references; it exists so callers don't need to change call
+// sites once a pager starts refcounting pages handed out by get().
+func (c *Cursor) Close() {
+	c.stack = nil
+	c.valid = false
+}
@@ -0,0 +1,126 @@
+package btree
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Sets up an in-memory BTree with keys k00..k19 inserted for cursor tests.
+func setupBtreeForScan(t *testing.T) *BTree {
+	pages := map[uint64][]byte{}
+	var next uint64 = 1
+	tree := New(
+		func(pgno uint64) []byte {
+			node, ok := pages[pgno]
+			if !ok {
+				t.Fatalf("get: no such page %d", pgno)
+			}
+			return node
+		},
+		func(data []byte) uint64 {
+			pgno := next
+			next++
+			pages[pgno] = append([]byte(nil), data...)
+			return pgno
+		},
+		func(pgno uint64) { delete(pages, pgno) },
+	)
+	for i := 0; i < 20; i++ {
+		key := []byte(fmt.Sprintf("k%02d", i))
+		val := []byte(fmt.Sprintf("v%02d", i))
+		tree.Insert(key, val)
+	}
+	return tree
+}
+
+func TestCursorSeekGEAndNext(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	cur := tree.SeekGE([]byte("k05"))
+	var got []string
+	for cur.Valid() {
+		got = append(got, string(cur.Key()))
+		cur.Next()
+	}
+	assert.Equal(t, 15, len(got))
+	assert.Equal(t, "k05", got[0])
+	assert.Equal(t, "k19", got[len(got)-1])
+}
+
+func TestCursorSeekGEBetweenKeys(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	// "k05a" doesn't exist, so SeekGE should land on the next real key.
+	cur := tree.SeekGE([]byte("k05a"))
+	assert.True(t, cur.Valid())
+	assert.Equal(t, "k06", string(cur.Key()))
+}
+
+func TestCursorSeekLE(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	cur := tree.SeekLE([]byte("k05a"))
+	assert.True(t, cur.Valid())
+	assert.Equal(t, "k05", string(cur.Key()))
+}
+
+func TestCursorBoundedScan(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	cur := tree.SeekGE([]byte("k05")).SetEnd([]byte("k08"))
+	var got []string
+	for cur.Valid() {
+		got = append(got, string(cur.Key()))
+		cur.Next()
+	}
+	assert.Equal(t, []string{"k05", "k06", "k07"}, got)
+}
+
+func TestCursorReverse(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	cur := tree.SeekLE([]byte("k10"))
+	var got []string
+	for cur.Valid() {
+		got = append(got, string(cur.Key()))
+		cur.Prev()
+	}
+	assert.Equal(t, "k10", got[0])
+	assert.Equal(t, "k00", got[len(got)-1])
+}
+
+// TestCursorReverseStopsBeforeSentinel checks that walking Prev() past the
+// lowest real key reports invalid rather than exposing the tree's internal
+// empty-key placeholder (see Insert's first-leaf case).
+func TestCursorReverseStopsBeforeSentinel(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	cur := tree.SeekLE([]byte("k00"))
+	assert.True(t, cur.Valid())
+	assert.Equal(t, "k00", string(cur.Key()))
+	assert.False(t, cur.Prev())
+	assert.False(t, cur.Valid())
+}
+
+// TestCursorSeekLEBelowLowestKey checks that SeekLE below every real key
+// reports invalid instead of landing on the internal sentinel.
+func TestCursorSeekLEBelowLowestKey(t *testing.T) {
+	tree := setupBtreeForScan(t)
+
+	cur := tree.SeekLE([]byte("j99"))
+	assert.False(t, cur.Valid())
+}
+
+func TestCursorEmptyTree(t *testing.T) {
+	tree := New(
+		func(uint64) []byte { t.Fatal("get should not be called"); return nil },
+		func([]byte) uint64 { t.Fatal("new should not be called"); return 0 },
+		func(uint64) {},
+	)
+
+	cur := tree.SeekGE([]byte("anything"))
+	assert.False(t, cur.Valid())
+	cur.Close()
+}
@@ -0,0 +1,104 @@
+package btree
+
+import (
+	"encoding/binary"
+
+	"kvs/internal/utils"
+)
+
+// Overflow pages hold the bytes of a value too big to fit inline in a
+// leaf (see BTREE_MAX_VAL_SIZE). A leaf stores a 16-byte reference
+// instead of the value, and the reference's first page starts a singly
+// linked chain:
+//
+//	| btype | unused |  next_pgno  |        data        |
+//	|  2B   |   2B   |     8B      |  up to page size-12 |
+const overflowHeaderSize = 12
+const overflowChunkSize = BTREE_PAGE_SIZE - overflowHeaderSize
+
+// overflowRefSize is the size of the reference a leaf stores in place of
+// an overflowed value: the value's real length plus the first page number.
+const overflowRefSize = 16
+
+func encodeOverflowRef(totalLen uint64, firstPgno uint64) []byte {
+	buf := make([]byte, overflowRefSize)
+	binary.LittleEndian.PutUint64(buf[0:8], totalLen)
+	binary.LittleEndian.PutUint64(buf[8:16], firstPgno)
+	return buf
+}
+
+func decodeOverflowRef(ref []byte) (totalLen uint64, firstPgno uint64) {
+	return binary.LittleEndian.Uint64(ref[0:8]), binary.LittleEndian.Uint64(ref[8:16])
+}
+
+func newOverflowPage(next uint64, chunk []byte) []byte {
+	utils.Assert(len(chunk) <= overflowChunkSize)
+	page := make([]byte, BTREE_PAGE_SIZE)
+	binary.LittleEndian.PutUint16(page[0:2], BNODE_OVERFLOW)
+	binary.LittleEndian.PutUint64(page[4:12], next)
+	copy(page[overflowHeaderSize:], chunk)
+	return page
+}
+
+func overflowNext(page []byte) uint64 {
+	return binary.LittleEndian.Uint64(page[4:12])
+}
+
+func overflowChunk(page []byte) []byte {
+	return page[overflowHeaderSize:]
+}
+
+// storeLeafVal returns the bytes a leaf should store for val: val itself,
+// or, once it's too big to fit inline, an overflow reference to a freshly
+// written chain (see BTREE_MAX_VAL_SIZE).
+func storeLeafVal(tree *BTree, val []byte) (stored []byte, isRef bool) {
+	if len(val) > BTREE_MAX_VAL_SIZE {
+		return encodeOverflowRef(uint64(len(val)), writeOverflowChain(tree, val)), true
+	}
+	return val, false
+}
+
+// writeOverflowChain persists data as a chain of overflow pages and
+// returns the first page's number. Pages are built tail-first so each one
+// already knows its successor's page number when it's written.
+func writeOverflowChain(tree *BTree, data []byte) uint64 {
+	var next uint64
+	for off := len(data); off > 0; {
+		start := off - overflowChunkSize
+		if start < 0 {
+			start = 0
+		}
+		next = tree.new(newOverflowPage(next, data[start:off]))
+		off = start
+	}
+	return next
+}
+
+// readOverflowChain reassembles the totalLen bytes stored in the chain
+// starting at firstPgno.
+func readOverflowChain(tree *BTree, firstPgno uint64, totalLen uint64) []byte {
+	out := make([]byte, 0, totalLen)
+	for pgno := firstPgno; pgno != 0 && uint64(len(out)) < totalLen; {
+		page := tree.get(pgno)
+		utils.Assert(binary.LittleEndian.Uint16(page[0:2]) == BNODE_OVERFLOW)
+		chunk := overflowChunk(page)
+		if remain := totalLen - uint64(len(out)); uint64(len(chunk)) > remain {
+			chunk = chunk[:remain]
+		}
+		out = append(out, chunk...)
+		pgno = overflowNext(page)
+	}
+	return out
+}
+
+// freeOverflowChain retires every page in the chain starting at firstPgno,
+// deferred through tree.freePage like any other page a write stops
+// referencing (see BTree.ReleaseSnapshotsOlderThan).
+func freeOverflowChain(tree *BTree, firstPgno uint64) {
+	for pgno := firstPgno; pgno != 0; {
+		page := tree.get(pgno)
+		next := overflowNext(page)
+		tree.freePage(pgno)
+		pgno = next
+	}
+}
@@ -0,0 +1,50 @@
+package btree
+
+import "bytes"
+
+// Snapshot is a frozen view of a BTree: the root and txid at the moment it
+// was taken. Because writes copy-on-write and only queue freed pages (see
+// BTree.freePage), the root a Snapshot captured stays fully readable for as
+// long as the snapshot is open, even while the tree keeps writing - the
+// writer never blocks on it and the snapshot never blocks the writer.
+type Snapshot struct {
+	tree *BTree
+	root uint64
+	txid uint64
+}
+
+// NewSnapshot captures the tree's current root, pinning its txid so
+// ReleaseSnapshotsOlderThan won't free a page this snapshot might still
+// walk to. Close the snapshot once done with it to release the pin.
+func (tree *BTree) NewSnapshot() *Snapshot {
+	s := &Snapshot{tree: tree, root: tree.root, txid: tree.txid}
+	tree.liveTxids[s.txid]++
+	return s
+}
+
+// Close releases the snapshot's pin on its txid.
+func (s *Snapshot) Close() {
+	s.tree.liveTxids[s.txid]--
+	if s.tree.liveTxids[s.txid] == 0 {
+		delete(s.tree.liveTxids, s.txid)
+	}
+}
+
+// Get looks up a key against the snapshot's frozen root.
+func (s *Snapshot) Get(key []byte) ([]byte, bool) {
+	if s.root == 0 {
+		return nil, false
+	}
+	return treeGet(s.tree, s.tree.get(s.root), key)
+}
+
+// FindGreaterThan returns a cursor over every key strictly greater than
+// key, in ascending order, walking the snapshot's frozen root rather than
+// whatever the tree's root has moved on to.
+func (s *Snapshot) FindGreaterThan(key []byte) *Cursor {
+	c := seekGE(s.tree, s.root, key)
+	if c.Valid() && bytes.Equal(c.Key(), key) {
+		c.Next()
+	}
+	return c
+}
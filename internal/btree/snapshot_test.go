@@ -0,0 +1,74 @@
+package btree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSnapshotSeesFrozenRoot takes a snapshot, then mutates the tree so the
+// live root moves off the snapshot's root page (which is only queued in
+// tree.pending, not released), and checks the snapshot still reads its
+// original value instead of whatever the live tree moved on to.
+func TestSnapshotSeesFrozenRoot(t *testing.T) {
+	tree := newMemTree(t)
+	tree.Insert([]byte("k1"), []byte("v1"))
+
+	snap := tree.NewSnapshot()
+
+	tree.Insert([]byte("k1"), []byte("v2"))
+	tree.Insert([]byte("k2"), []byte("v3"))
+
+	val, ok := snap.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v1"), val)
+
+	_, ok = snap.Get([]byte("k2"))
+	assert.False(t, ok, "snapshot shouldn't see a key inserted after it was taken")
+
+	val, ok = tree.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v2"), val)
+
+	snap.Close()
+}
+
+// TestSnapshotFindGreaterThan exercises range scans against a frozen root
+// taken mid-way through a sequence of inserts.
+func TestSnapshotFindGreaterThan(t *testing.T) {
+	tree := newMemTree(t)
+	tree.Insert([]byte("k1"), []byte("v1"))
+	tree.Insert([]byte("k3"), []byte("v3"))
+
+	snap := tree.NewSnapshot()
+	tree.Insert([]byte("k2"), []byte("v2"))
+
+	cur := snap.FindGreaterThan([]byte("k1"))
+	assert.True(t, cur.Valid())
+	assert.Equal(t, []byte("k3"), cur.Key())
+	assert.False(t, cur.Next(), "snapshot shouldn't see k2, inserted after it was taken")
+
+	snap.Close()
+}
+
+// TestReleaseSnapshotsOlderThan checks that pending-free pages stay pinned
+// while a snapshot older than them is open, and get released once it closes.
+func TestReleaseSnapshotsOlderThan(t *testing.T) {
+	tree := newMemTree(t)
+	tree.Insert([]byte("k1"), []byte("v1"))
+
+	snap := tree.NewSnapshot()
+	tree.Insert([]byte("k1"), []byte("v2")) // frees the page snap's root points at
+
+	assert.NotEmpty(t, tree.pending)
+	tree.ReleaseSnapshotsOlderThan(tree.txid)
+	assert.NotEmpty(t, tree.pending, "still pinned by the open snapshot")
+
+	val, ok := snap.Get([]byte("k1"))
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v1"), val)
+
+	snap.Close()
+	tree.ReleaseSnapshotsOlderThan(tree.txid)
+	assert.Empty(t, tree.pending, "no snapshot left to pin it, should be drained")
+}
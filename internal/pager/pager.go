@@ -0,0 +1,248 @@
+// Package pager memory-maps a growing file of BTREE_PAGE_SIZE pages and
+// exposes the get/new/del callback shape that btree.BTree expects, so a
+// BTree can be backed by disk instead of an in-memory map.
+package pager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+	"syscall"
+
+	"kvs/internal/btree"
+	"kvs/internal/utils"
+)
+
+const pageSize = btree.BTREE_PAGE_SIZE
+
+// meta is the content of page 0: everything needed to resume a tree
+// without replaying anything.
+type meta struct {
+	root     uint64 // btree.BTree root page number, 0 if empty
+	next     uint64 // next never-used page number
+	freeHead uint64 // head of the freelist, 0 if empty
+	treeSize uint64 // number of live (non-free) pages, for diagnostics
+}
+
+const metaMagic = "KVSPAGE1"
+
+// metaLen is the number of meaningful bytes in an encoded meta page
+// (magic + 4 uint64 fields + a checksum); the rest of page 0 is unused.
+const metaLen = 8 + 4*8 + 4
+
+func encodeMeta(m meta) []byte {
+	buf := make([]byte, pageSize)
+	copy(buf[0:8], metaMagic)
+	binary.LittleEndian.PutUint64(buf[8:16], m.root)
+	binary.LittleEndian.PutUint64(buf[16:24], m.next)
+	binary.LittleEndian.PutUint64(buf[24:32], m.freeHead)
+	binary.LittleEndian.PutUint64(buf[32:40], m.treeSize)
+	sum := crc32.ChecksumIEEE(buf[0:40])
+	binary.LittleEndian.PutUint32(buf[40:44], sum)
+	return buf
+}
+
+// decodeMeta validates the magic and checksum before trusting a meta page,
+// so a write torn by a crash mid-Commit is detected rather than silently
+// handing back a mismatched root/freelist pair.
+func decodeMeta(page []byte) (meta, bool) {
+	if len(page) < metaLen || string(page[0:8]) != metaMagic {
+		return meta{}, false
+	}
+	sum := binary.LittleEndian.Uint32(page[40:44])
+	if crc32.ChecksumIEEE(page[0:40]) != sum {
+		return meta{}, false
+	}
+	return meta{
+		root:     binary.LittleEndian.Uint64(page[8:16]),
+		next:     binary.LittleEndian.Uint64(page[16:24]),
+		freeHead: binary.LittleEndian.Uint64(page[24:32]),
+		treeSize: binary.LittleEndian.Uint64(page[32:40]),
+	}, true
+}
+
+// Pager memory-maps path in pageSize chunks, page 0 being a meta page and
+// every other page either live tree data or a link in the freelist.
+//
+// Pager supports one writer (New/Del/Commit) concurrent with any number of
+// readers (Get, e.g. from a Snapshot's own goroutine) - mu protects data
+// itself, which extend() reassigns out from under any in-progress Get
+// whenever a write grows the file.
+type Pager struct {
+	fd   *os.File
+	mu   sync.RWMutex
+	data []byte // mmap of the whole file, a multiple of pageSize long
+	meta meta
+}
+
+// Open opens (creating if necessary) the database file at path.
+func Open(path string) (*Pager, error) {
+	fd, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0664)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	p := &Pager{fd: fd}
+	fresh := info.Size() == 0
+	if fresh {
+		p.meta = meta{next: 1} // page 0 is meta, so real pages start at 1
+		if err := fd.Truncate(pageSize); err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+	if err := p.mmap(); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	if fresh {
+		// write a real meta page now, not just in memory: otherwise a clean
+		// Open/Close with no writes leaves page 0 all zeros, and the next
+		// Open mistakes that for a corrupt (rather than merely empty) file.
+		copy(p.data[:pageSize], encodeMeta(p.meta))
+		if err := fd.Sync(); err != nil {
+			syscall.Munmap(p.data)
+			fd.Close()
+			return nil, err
+		}
+	} else {
+		m, ok := decodeMeta(p.data[:pageSize])
+		if !ok {
+			syscall.Munmap(p.data)
+			fd.Close()
+			return nil, fmt.Errorf("pager: corrupt meta page in %s", path)
+		}
+		p.meta = m
+	}
+	return p, nil
+}
+
+func (p *Pager) mmap() error {
+	info, err := p.fd.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := syscall.Mmap(int(p.fd.Fd()), 0, int(info.Size()),
+		syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	p.data = data
+	return nil
+}
+
+// extend grows the file (and remaps it) so that page numbers up to
+// minPages-1 are addressable, doubling capacity each time like a growing
+// slice so a long run of inserts isn't one remap per page.
+func (p *Pager) extend(minPages uint64) error {
+	cur := uint64(len(p.data)) / pageSize
+	if minPages <= cur {
+		return nil
+	}
+	next := cur
+	if next == 0 {
+		next = 1
+	}
+	for next < minPages {
+		next *= 2
+	}
+	if err := syscall.Munmap(p.data); err != nil {
+		return err
+	}
+	if err := p.fd.Truncate(int64(next) * pageSize); err != nil {
+		return err
+	}
+	return p.mmap()
+}
+
+// Get returns a copy of page pgno's data. It's safe to hold onto across any
+// later call, unlike the mmap itself: New can grow the file, which remaps
+// it (see extend) and invalidates any slice aliasing the old mapping. Safe
+// to call concurrently with a single other goroutine driving New/Del/Commit
+// (see Pager's doc comment).
+func (p *Pager) Get(pgno uint64) []byte {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	page := make([]byte, pageSize)
+	copy(page, p.rawPage(pgno))
+	return page
+}
+
+// rawPage returns a view of page pgno aliased directly into the mmap, for
+// pager-internal use only: the slice is invalidated by any later call that
+// may grow the file (New, via extend), so it must be read or written
+// before returning to the caller, never retained.
+func (p *Pager) rawPage(pgno uint64) []byte {
+	off := pgno * pageSize
+	return p.data[off : off+pageSize]
+}
+
+// New copies data into a fresh page, preferring a freed page over growing
+// the file, and returns its page number.
+func (p *Pager) New(data []byte) uint64 {
+	utils.Assert(uint64(len(data)) <= pageSize)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var pgno uint64
+	if p.meta.freeHead != 0 {
+		pgno = p.meta.freeHead
+		p.meta.freeHead = binary.LittleEndian.Uint64(p.rawPage(pgno)[:8])
+	} else {
+		pgno = p.meta.next
+		p.meta.next++
+		if err := p.extend(p.meta.next); err != nil {
+			panic(err) // the BTree callback signature has no error return
+		}
+	}
+	p.meta.treeSize++
+	copy(p.rawPage(pgno), data)
+	return pgno
+}
+
+// Del pushes pgno onto the freelist, threading the link through the
+// page's own first 8 bytes rather than a side table.
+func (p *Pager) Del(pgno uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	page := p.rawPage(pgno)
+	binary.LittleEndian.PutUint64(page[:8], p.meta.freeHead)
+	p.meta.freeHead = pgno
+	p.meta.treeSize--
+}
+
+// Root returns the tree root persisted in the meta page.
+func (p *Pager) Root() uint64 { return p.meta.root }
+
+// SetRoot records a new tree root for the next Commit.
+func (p *Pager) SetRoot(root uint64) { p.meta.root = root }
+
+// Commit flushes every data page written since the last Commit, then
+// overwrites the meta page and flushes again. Page 0 is rewritten last so
+// that a crash between the two syncs leaves the previous, still
+// self-consistent root in place rather than a root that points at pages
+// the first sync never reached.
+func (p *Pager) Commit() error {
+	if err := p.fd.Sync(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	copy(p.data[:pageSize], encodeMeta(p.meta))
+	p.mu.Unlock()
+	return p.fd.Sync()
+}
+
+// Close unmaps the file and closes its descriptor.
+func (p *Pager) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := syscall.Munmap(p.data); err != nil {
+		return err
+	}
+	return p.fd.Close()
+}